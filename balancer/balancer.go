@@ -0,0 +1,148 @@
+// Package balancer picks, for a set of upstream URLs backing a single
+// route, which one should handle the next request. It also tracks backend
+// health via active probing and passive error ejection so a dead upstream
+// stops receiving traffic until it recovers.
+package balancer
+
+import (
+	"math/rand"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// Strategy selects how Pool.Next picks among the healthy backends.
+type Strategy string
+
+const (
+	RoundRobin     Strategy = "round-robin"
+	Random         Strategy = "random"
+	LeastConn      Strategy = "least-conn"
+	defaultMaxFail int32    = 3
+	minBackoff              = time.Second
+	maxBackoff              = 30 * time.Second
+)
+
+// Backend is a single upstream URL and its liveness bookkeeping.
+type Backend struct {
+	URL *url.URL
+
+	conns               int64
+	consecutiveFailures int32
+	down                int32 // 0 = up, 1 = ejected
+	nextRetryAt         int64 // unix nano, only meaningful while down
+	backoff             int64 // nanoseconds, grows on repeated trips
+}
+
+// Acquire must be called before proxying a request to this backend and
+// Release once the request has finished, so LeastConn has an accurate count.
+func (b *Backend) Acquire() { atomic.AddInt64(&b.conns, 1) }
+func (b *Backend) Release() { atomic.AddInt64(&b.conns, -1) }
+
+func (b *Backend) inflight() int64 { return atomic.LoadInt64(&b.conns) }
+
+// Healthy reports whether the backend should be considered for new
+// requests: either it was never ejected, or its backoff cooldown elapsed.
+func (b *Backend) Healthy() bool {
+	if atomic.LoadInt32(&b.down) == 0 {
+		return true
+	}
+	return time.Now().UnixNano() >= atomic.LoadInt64(&b.nextRetryAt)
+}
+
+// RecordSuccess clears any failure streak and brings the backend back up.
+func (b *Backend) RecordSuccess() {
+	atomic.StoreInt32(&b.consecutiveFailures, 0)
+	atomic.StoreInt32(&b.down, 0)
+	atomic.StoreInt64(&b.backoff, 0)
+}
+
+// RecordFailure accounts for a dial error or 5xx response. Once maxFailures
+// consecutive failures are seen the backend is ejected for an
+// exponentially growing cooldown.
+func (b *Backend) RecordFailure(maxFailures int32) {
+	if maxFailures <= 0 {
+		maxFailures = defaultMaxFail
+	}
+	failures := atomic.AddInt32(&b.consecutiveFailures, 1)
+	if failures < maxFailures {
+		return
+	}
+	backoff := time.Duration(atomic.LoadInt64(&b.backoff))
+	if backoff == 0 {
+		backoff = minBackoff
+	} else {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	atomic.StoreInt64(&b.backoff, int64(backoff))
+	atomic.StoreInt32(&b.down, 1)
+	atomic.StoreInt64(&b.nextRetryAt, time.Now().Add(backoff).UnixNano())
+}
+
+// Pool is the set of backends serving a single route.
+type Pool struct {
+	Strategy Strategy
+	backends []*Backend
+
+	// MaxFailures is the number of consecutive failures that ejects a
+	// backend via RecordFailure. Defaults to 3 when zero.
+	MaxFailures int32
+
+	roundRobinCounter uint64
+}
+
+// NewPool builds a Pool over upstreams using strategy. An empty/unknown
+// strategy falls back to round-robin.
+func NewPool(upstreams []string, strategy Strategy) (*Pool, error) {
+	backends := make([]*Backend, 0, len(upstreams))
+	for _, raw := range upstreams {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		backends = append(backends, &Backend{URL: u})
+	}
+	switch strategy {
+	case Random, LeastConn, RoundRobin:
+	default:
+		strategy = RoundRobin
+	}
+	return &Pool{Strategy: strategy, backends: backends}, nil
+}
+
+// Backends returns every backend in the pool, healthy or not, for use by
+// the active health checker.
+func (p *Pool) Backends() []*Backend { return p.backends }
+
+// Next picks the backend that should serve the next request, skipping
+// backends that are currently ejected. It returns false if every backend
+// in the pool is down.
+func (p *Pool) Next() (*Backend, bool) {
+	healthy := make([]*Backend, 0, len(p.backends))
+	for _, b := range p.backends {
+		if b.Healthy() {
+			healthy = append(healthy, b)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil, false
+	}
+	switch p.Strategy {
+	case Random:
+		return healthy[rand.Intn(len(healthy))], true
+	case LeastConn:
+		best := healthy[0]
+		for _, b := range healthy[1:] {
+			if b.inflight() < best.inflight() {
+				best = b
+			}
+		}
+		return best, true
+	default: // RoundRobin
+		i := atomic.AddUint64(&p.roundRobinCounter, 1)
+		return healthy[int(i)%len(healthy)], true
+	}
+}
@@ -0,0 +1,72 @@
+package balancer
+
+import "testing"
+
+func TestPoolNextRoundRobinCyclesBackends(t *testing.T) {
+	pool, err := NewPool([]string{"http://a", "http://b"}, RoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		b, ok := pool.Next()
+		if !ok {
+			t.Fatal("expected a healthy backend")
+		}
+		seen[b.URL.String()] = true
+	}
+	if len(seen) != 2 {
+		t.Fatalf("round-robin over 4 picks saw %d distinct backends, want 2", len(seen))
+	}
+}
+
+func TestPoolNextSkipsEjectedBackends(t *testing.T) {
+	pool, err := NewPool([]string{"http://a", "http://b"}, RoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := pool.Backends()[0]
+	for i := 0; i < 3; i++ {
+		down.RecordFailure(3)
+	}
+	if down.Healthy() {
+		t.Fatal("expected the backend to be ejected after 3 consecutive failures")
+	}
+	for i := 0; i < 4; i++ {
+		b, ok := pool.Next()
+		if !ok {
+			t.Fatal("expected a healthy backend")
+		}
+		if b == down {
+			t.Fatal("Next returned an ejected backend")
+		}
+	}
+}
+
+func TestPoolNextFalseWhenAllBackendsDown(t *testing.T) {
+	pool, err := NewPool([]string{"http://a"}, RoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	only := pool.Backends()[0]
+	for i := 0; i < 3; i++ {
+		only.RecordFailure(3)
+	}
+	if _, ok := pool.Next(); ok {
+		t.Fatal("expected Next to report no healthy backend")
+	}
+}
+
+func TestRecordSuccessClearsEjection(t *testing.T) {
+	b := &Backend{}
+	for i := 0; i < 3; i++ {
+		b.RecordFailure(3)
+	}
+	if b.Healthy() {
+		t.Fatal("expected the backend to be ejected")
+	}
+	b.RecordSuccess()
+	if !b.Healthy() {
+		t.Fatal("expected RecordSuccess to clear the ejection")
+	}
+}
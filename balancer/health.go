@@ -0,0 +1,74 @@
+package balancer
+
+import (
+	"net/http"
+	"time"
+)
+
+// HealthChecker periodically probes every backend in a Pool and feeds each
+// result into the same bookkeeping as passive ejection: a failed probe is
+// one RecordFailure, so a single failed probe does not take a backend down;
+// it is ejected only once MaxFailures consecutive failures (probes and
+// proxied requests together) are seen. A successful probe calls
+// RecordSuccess, which clears any ejection.
+type HealthChecker struct {
+	Pool     *Pool
+	Path     string
+	Interval time.Duration
+	Client   *http.Client
+}
+
+// defaultHealthCheckInterval is used when a path is configured but no
+// interval is, so a route that only sets healthCheckPath still gets active
+// checking instead of silently getting none.
+const defaultHealthCheckInterval = 10 * time.Second
+
+// NewHealthChecker builds a checker that GETs path on each backend every
+// interval, defaulting interval to defaultHealthCheckInterval when path is
+// set but interval isn't. An empty path disables active checking (Run
+// returns immediately) regardless of interval.
+func NewHealthChecker(pool *Pool, path string, interval time.Duration) *HealthChecker {
+	if path != "" && interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	return &HealthChecker{
+		Pool:     pool,
+		Path:     path,
+		Interval: interval,
+		Client:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Run blocks, probing every backend in the pool on Interval, until stop is
+// closed. Call it in its own goroutine.
+func (h *HealthChecker) Run(stop <-chan struct{}) {
+	if h.Interval <= 0 || h.Path == "" {
+		return
+	}
+	ticker := time.NewTicker(h.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, b := range h.Pool.Backends() {
+				h.probe(b)
+			}
+		}
+	}
+}
+
+func (h *HealthChecker) probe(b *Backend) {
+	resp, err := h.Client.Get(b.URL.String() + h.Path)
+	if err != nil {
+		b.RecordFailure(h.Pool.MaxFailures)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b.RecordFailure(h.Pool.MaxFailures)
+		return
+	}
+	b.RecordSuccess()
+}
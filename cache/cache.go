@@ -0,0 +1,159 @@
+// Package cache implements a bounded, RFC 7234-aware HTTP response cache
+// for the proxy, replacing the previous unbounded sync.Map keyed only on
+// the request path.
+package cache
+
+import (
+	"net/http"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// Entry is a stored response, enough of it to both replay the response and
+// revalidate it against the upstream once it goes stale.
+type Entry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	ETag         string
+	LastModified string
+
+	StoredAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Stale reports whether the entry is past its freshness lifetime and should
+// be revalidated before being served again.
+func (e *Entry) Stale() bool {
+	return time.Now().After(e.ExpiresAt)
+}
+
+// Revalidatable reports whether the entry carries a validator that lets us
+// issue a conditional request instead of a full re-fetch.
+func (e *Entry) Revalidatable() bool {
+	return e.ETag != "" || e.LastModified != ""
+}
+
+// Cache is a bounded LRU of HTTP responses, keyed by method+scheme+host+
+// path+query plus whatever request headers the stored response's Vary
+// named.
+type Cache struct {
+	entries      *lru.Cache[string, *Entry]
+	varyByRoute  *lru.Cache[string, []string]
+	maxBodyBytes int
+	defaultTTL   time.Duration
+}
+
+// New builds a Cache holding at most maxEntries responses, each at most
+// maxBodyBytes large, falling back to defaultTTL when a response carries no
+// cache-control freshness directive.
+func New(maxEntries, maxBodyBytes int, defaultTTL time.Duration) (*Cache, error) {
+	entries, err := lru.New[string, *Entry](maxEntries)
+	if err != nil {
+		return nil, err
+	}
+	varyByRoute, err := lru.New[string, []string](maxEntries)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{
+		entries:      entries,
+		varyByRoute:  varyByRoute,
+		maxBodyBytes: maxBodyBytes,
+		defaultTTL:   defaultTTL,
+	}, nil
+}
+
+// Key identifies req for the purposes of this cache. Callers that mutate
+// req (e.g. rewriting its Host/URL before proxying it upstream) must
+// compute this once, before mutating, and pass the same value to Lookup,
+// Refresh and Store: recomputing it from the same *http.Request at
+// different points in its lifecycle can key a stored response under
+// state (like a rewritten Host) that the original request never had.
+func (c *Cache) Key(req *http.Request) string {
+	return baseKey(req)
+}
+
+// Lookup returns the cached entry for req under key, if any, honoring
+// request-side Cache-Control/Pragma: a request asking for revalidation
+// never gets a direct hit, even if a fresh entry exists.
+func (c *Cache) Lookup(key string, req *http.Request) (*Entry, bool) {
+	if requestWantsRevalidation(req.Header.Get("Cache-Control")) || req.Header.Get("Pragma") == "no-cache" {
+		return nil, false
+	}
+	vary, _ := c.varyByRoute.Get(key)
+	entry, ok := c.entries.Get(varyKey(key, vary, req))
+	return entry, ok
+}
+
+// ApplyValidators sets If-None-Match/If-Modified-Since on the outgoing
+// request so a stale entry can be revalidated instead of fully re-fetched.
+func ApplyValidators(req *http.Request, entry *Entry) {
+	if entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+}
+
+// Refresh bumps a revalidated entry's freshness lifetime after the upstream
+// answered 304 Not Modified, and stores it back under the same key.
+func (c *Cache) Refresh(key string, req *http.Request, entry *Entry, ttl time.Duration) {
+	entry.StoredAt = time.Now()
+	entry.ExpiresAt = entry.StoredAt.Add(ttl)
+	vary, _ := c.varyByRoute.Get(key)
+	c.entries.Add(varyKey(key, vary, req), entry)
+}
+
+// Store saves a response if it is cacheable per the upstream's
+// Cache-Control, skipping bodies over maxBodyBytes.
+func (c *Cache) Store(key string, req *http.Request, statusCode int, header http.Header, body []byte) {
+	if len(body) > c.maxBodyBytes {
+		return
+	}
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	if cc.has("no-store") || cc.has("private") {
+		return
+	}
+	ttl, ok := ttlFromDirectives(cc)
+	if !ok {
+		ttl = c.defaultTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	vary := parseVary(header.Get("Vary"))
+	c.varyByRoute.Add(key, vary)
+	now := time.Now()
+	c.entries.Add(varyKey(key, vary, req), &Entry{
+		StatusCode:   statusCode,
+		Header:       header.Clone(),
+		Body:         body,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		StoredAt:     now,
+		ExpiresAt:    now.Add(ttl),
+	})
+}
+
+// ttlFromDirectives derives a freshness lifetime from s-maxage or max-age,
+// s-maxage taking precedence as it does for shared caches in RFC 7234.
+func ttlFromDirectives(cc directives) (time.Duration, bool) {
+	if s, ok := cc.seconds("s-maxage"); ok {
+		return time.Duration(s) * time.Second, true
+	}
+	if s, ok := cc.seconds("max-age"); ok {
+		return time.Duration(s) * time.Second, true
+	}
+	return 0, false
+}
+
+// TTLFromHeader derives a freshness lifetime from a response's
+// Cache-Control header, for callers (e.g. revalidation responses) that
+// don't go through Store.
+func TTLFromHeader(header http.Header) (time.Duration, bool) {
+	return ttlFromDirectives(parseCacheControl(header.Get("Cache-Control")))
+}
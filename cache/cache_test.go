@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStoreLookupRoundTrip(t *testing.T) {
+	c, err := New(10, 1<<20, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	key := c.Key(req)
+	header := http.Header{"Cache-Control": []string{"max-age=60"}}
+
+	c.Store(key, req, http.StatusOK, header, []byte("hello"))
+
+	entry, ok := c.Lookup(key, req)
+	if !ok {
+		t.Fatal("expected a cache hit after Store")
+	}
+	if string(entry.Body) != "hello" {
+		t.Fatalf("got body %q, want %q", entry.Body, "hello")
+	}
+}
+
+// TestStoreLookupRoundTripAfterHostRewrite guards against keying Store and
+// Lookup from the same *http.Request at different points in its lifecycle:
+// a caller that rewrites req.Host (e.g. for a rewriteHost route) between
+// Lookup and Store must still key both under the same value by capturing
+// Key(req) once, before the rewrite.
+func TestStoreLookupRoundTripAfterHostRewrite(t *testing.T) {
+	c, err := New(10, 1<<20, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	key := c.Key(req)
+
+	req.Host = "backend.internal"
+	req.URL.Host = "backend.internal"
+
+	c.Store(key, req, http.StatusOK, http.Header{}, []byte("hello"))
+
+	entry, ok := c.Lookup(key, req)
+	if !ok {
+		t.Fatal("expected a cache hit for the key captured before the Host rewrite")
+	}
+	if string(entry.Body) != "hello" {
+		t.Fatalf("got body %q, want %q", entry.Body, "hello")
+	}
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+)
+
+// directives is a parsed Cache-Control header, keyed by directive name in
+// lower case. The value is empty for flag directives (e.g. "no-store").
+type directives map[string]string
+
+func parseCacheControl(header string) directives {
+	d := make(directives)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if i := strings.IndexByte(part, '='); i != -1 {
+			name := strings.ToLower(strings.TrimSpace(part[:i]))
+			val := strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+			d[name] = val
+		} else {
+			d[strings.ToLower(part)] = ""
+		}
+	}
+	return d
+}
+
+func (d directives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+func (d directives) seconds(name string) (int, bool) {
+	raw, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func requestWantsRevalidation(header string) bool {
+	return parseCacheControl(header).has("no-cache")
+}
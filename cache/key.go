@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// baseKey identifies a request regardless of any Vary headers: it is what
+// we use to look up which request headers (if any) must also be folded
+// into the final cache key.
+func baseKey(req *http.Request) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	var b strings.Builder
+	b.WriteString(req.Method)
+	b.WriteByte(' ')
+	b.WriteString(scheme)
+	b.WriteString("://")
+	b.WriteString(req.Host)
+	b.WriteString(req.URL.Path)
+	b.WriteByte('?')
+	b.WriteString(req.URL.RawQuery)
+	return b.String()
+}
+
+// varyKey extends a baseKey with the request header values named by
+// varyHeaders, so two requests that only differ in a Vary'd header (e.g.
+// Accept-Encoding) get distinct cache entries.
+func varyKey(base string, varyHeaders []string, req *http.Request) string {
+	if len(varyHeaders) == 0 {
+		return base
+	}
+	h := sha256.New()
+	h.Write([]byte(base))
+	for _, name := range varyHeaders {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.ToLower(name)))
+		h.Write([]byte{'='})
+		h.Write([]byte(req.Header.Get(name)))
+	}
+	return base + "#" + hex.EncodeToString(h.Sum(nil))
+}
+
+func parseVary(header string) []string {
+	if header == "" {
+		return nil
+	}
+	parts := strings.Split(header, ",")
+	vary := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" && p != "*" {
+			vary = append(vary, p)
+		}
+	}
+	return vary
+}
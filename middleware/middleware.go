@@ -0,0 +1,18 @@
+// Package middleware provides a small func(http.Handler) http.Handler
+// chain, plus the built-in middlewares operators can opt into through the
+// routing config: Recover, RequestID, RateLimit and Prometheus.
+package middleware
+
+import "net/http"
+
+// Middleware wraps an http.Handler with additional behaviour.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wires mws around h, in the order given: the first middleware is the
+// outermost one, so it sees the request before the others do.
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
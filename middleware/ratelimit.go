@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"golang.org/x/time/rate"
+)
+
+// maxTrackedClients bounds how many distinct client IPs keep their own
+// limiter at once. Beyond that, the least recently seen client is evicted
+// (and simply starts a fresh bucket if it comes back), so a proxy facing
+// many distinct IPs (NAT churn, IPv6, or abuse aimed at the limiter itself)
+// can't grow this without bound.
+const maxTrackedClients = 10000
+
+// RateLimit builds a middleware enforcing a token-bucket of rps requests
+// per second (burst capacity burst) per client IP. Clients over the limit
+// get 429 Too Many Requests.
+func RateLimit(rps float64, burst int) Middleware {
+	limiters := newPerClientLimiters(rps, burst)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiters.forClient(clientIP(r)).Allow() {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type perClientLimiters struct {
+	limiters *lru.Cache[string, *rate.Limiter]
+	rps      rate.Limit
+	burst    int
+}
+
+func newPerClientLimiters(rps float64, burst int) *perClientLimiters {
+	// Only errors when maxTrackedClients <= 0, which it never is.
+	cache, _ := lru.New[string, *rate.Limiter](maxTrackedClients)
+	return &perClientLimiters{limiters: cache, rps: rate.Limit(rps), burst: burst}
+}
+
+func (p *perClientLimiters) forClient(ip string) *rate.Limiter {
+	if l, ok := p.limiters.Get(ip); ok {
+		return l
+	}
+	// PeekOrAdd is atomic, so two concurrent first-requests from the same
+	// new IP can't each create their own limiter and race on which one
+	// wins the cache: exactly one rate.Limiter is ever stored per IP.
+	l := rate.NewLimiter(p.rps, p.burst)
+	if previous, ok, _ := p.limiters.PeekOrAdd(ip, l); ok {
+		return previous
+	}
+	return l
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
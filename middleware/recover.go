@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Murilovisque/logs"
+)
+
+// Recover catches panics from the wrapped handler, logs them with the
+// request's ID when available, and answers 500 instead of crashing the
+// whole server.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				logger := logs.NewLogger(logs.FieldValue{Key: "reqID", Val: RequestIDFromContext(r.Context())})
+				logger.Error(fmt.Errorf("panic: %v", rec))
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+)
+
+type contextKey int
+
+const requestIDKey contextKey = 0
+
+// RequestIDHeader is both read, to propagate an incoming request ID, and
+// written, so the caller can correlate the response with proxy logs.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID assigns each request an ID, reusing one supplied by the caller
+// via the X-Request-ID header instead of always minting a new one, and
+// makes it available to handlers via RequestIDFromContext.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = strconv.Itoa(rand.Intn(100000))
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the request ID assigned by RequestID, or ""
+// if the middleware wasn't installed.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
@@ -7,39 +7,54 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"net/http/httputil"
-	"net/url"
 	"os"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/Murilovisque/go-proxy/balancer"
+	proxycache "github.com/Murilovisque/go-proxy/cache"
+	"github.com/Murilovisque/go-proxy/middleware"
+	"github.com/Murilovisque/go-proxy/router"
+	"github.com/Murilovisque/go-proxy/upstreamauth"
 	"github.com/Murilovisque/logs"
 )
 
 var (
-	cache sync.Map
+	respCache *proxycache.Cache
 	targetHost string
+	configFile string
 	port int
 	isSLL bool
 	httpProtocol string = "http"
 	printRequest bool
 	printTargetResponse bool
 	cacheTimeout = 5
+	cacheMaxEntries = 10000
+	cacheMaxBodyBytes = 1 << 20
+	metricsAddr string
+	routes *router.Router
+	pools map[*router.Route]*balancer.Pool
+	upstreamAuths map[*router.Route]*upstreamauth.Injector
 )
 
 func init() {
 	flag.StringVar(&targetHost, "target", "", "target host")
+	flag.StringVar(&configFile, "config", "", "routing config file (YAML or JSON), takes precedence over -target")
 	flag.IntVar(&port, "port", -1, "bind port")
 	flag.BoolVar(&isSLL, "use-ssl", false, "use-ssl")
 	flag.BoolVar(&printRequest, "log-origin-request", false, "Log origin request")
 	flag.BoolVar(&printTargetResponse, "log-target-response", false, "Log target response")
-	flag.IntVar(&cacheTimeout, "cache-timeout", 5, "Cache timeout")
-	flag.Parse()
+	flag.IntVar(&cacheTimeout, "cache-timeout", 5, "Cache timeout used when a response carries no Cache-Control/max-age")
+	flag.IntVar(&cacheMaxEntries, "cache-max-entries", 10000, "Maximum number of cached responses")
+	flag.IntVar(&cacheMaxBodyBytes, "cache-max-body-bytes", 1<<20, "Maximum cacheable response body size, in bytes")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "bind address for the Prometheus metrics listener, e.g. :9090 (disabled when empty)")
 }
 
 func main() {
+	flag.Parse()
 	err := validParams()
 	if err != nil {
 		fmt.Println(err)
@@ -50,11 +65,53 @@ func main() {
 	if isSLL {
 		httpProtocol = "https"
 	}
-	http.HandleFunc("/", serveReverseProxy)
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	routes = router.New(cfg)
+	pools = buildPools(cfg)
+	upstreamAuths, err = buildUpstreamAuths(cfg)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	respCache, err = proxycache.New(cacheMaxEntries, cacheMaxBodyBytes, time.Duration(cacheTimeout)*time.Minute)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if metricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", middleware.MetricsHandler())
+			log.Fatal(http.ListenAndServe(metricsAddr, mux))
+		}()
+	}
+	http.Handle("/", buildHandler(cfg.Middleware))
 	log.Println("Starting proxy with cache", cacheTimeout, "minute(s)")
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
 }
 
+// buildHandler wraps serveReverseProxy with the middlewares enabled in cfg.
+func buildHandler(cfg router.MiddlewareConfig) http.Handler {
+	var mws []middleware.Middleware
+	if cfg.RequestID {
+		mws = append(mws, middleware.RequestID)
+	}
+	if cfg.Recover {
+		mws = append(mws, middleware.Recover)
+	}
+	if cfg.RateLimit != nil {
+		mws = append(mws, middleware.RateLimit(cfg.RateLimit.RPS, cfg.RateLimit.Burst))
+	}
+	if cfg.Prometheus {
+		mws = append(mws, middleware.Prometheus)
+	}
+	return middleware.Chain(http.HandlerFunc(serveReverseProxy), mws...)
+}
+
 func validParams() error {
 	if port < 1 {
 		return fmt.Errorf("Invalid port %d", port)
@@ -62,9 +119,66 @@ func validParams() error {
 	if cacheTimeout < 1 {
 		return fmt.Errorf("Invalid cache-timeout %d", cacheTimeout)
 	}
+	if configFile == "" && targetHost == "" {
+		return fmt.Errorf("either -config or -target must be set")
+	}
 	return nil
 }
 
+// loadConfig builds the routing Config either from -config, when given, or
+// from the legacy single -target flag so existing deployments keep working
+// unchanged.
+func loadConfig() (*router.Config, error) {
+	if configFile != "" {
+		return router.LoadConfig(configFile)
+	}
+	return &router.Config{
+		Routes: []router.Route{
+			{
+				Host:        "*",
+				Location:    "/",
+				RewriteHost: true,
+				Upstreams:   []string{fmt.Sprintf("%s://%s", httpProtocol, targetHost)},
+			},
+		},
+	}, nil
+}
+
+// buildPools creates one balancer.Pool per route and, when configured,
+// starts its active health checker goroutine.
+func buildPools(cfg *router.Config) map[*router.Route]*balancer.Pool {
+	result := make(map[*router.Route]*balancer.Pool, len(cfg.Routes))
+	for i := range cfg.Routes {
+		route := &cfg.Routes[i]
+		pool, err := balancer.NewPool(route.Upstreams, balancer.Strategy(route.Strategy))
+		if err != nil {
+			log.Fatalf("route %s%s: %v", route.Host, route.Location, err)
+		}
+		pool.MaxFailures = int32(route.MaxFailures)
+		result[route] = pool
+		if route.HealthCheckPath != "" {
+			checker := balancer.NewHealthChecker(pool, route.HealthCheckPath, time.Duration(route.HealthCheckIntervalSeconds)*time.Second)
+			go checker.Run(nil)
+		}
+	}
+	return result
+}
+
+// buildUpstreamAuths creates one upstreamauth.Injector per route, which is
+// a no-op for routes without an upstreamAuth block.
+func buildUpstreamAuths(cfg *router.Config) (map[*router.Route]*upstreamauth.Injector, error) {
+	result := make(map[*router.Route]*upstreamauth.Injector, len(cfg.Routes))
+	for i := range cfg.Routes {
+		route := &cfg.Routes[i]
+		injector, err := upstreamauth.New(route.UpstreamAuth)
+		if err != nil {
+			return nil, fmt.Errorf("route %s%s: %v", route.Host, route.Location, err)
+		}
+		result[route] = injector
+	}
+	return result, nil
+}
+
 func readRequest(logger *logs.Logger, req *http.Request) error {
 	if !printRequest || req.Method == http.MethodGet {
 		return nil
@@ -82,45 +196,183 @@ func readRequest(logger *logs.Logger, req *http.Request) error {
 }
 
 func serveReverseProxy(res http.ResponseWriter, req *http.Request) {
-	logger := logs.NewLogger(logs.FieldValue{Key: "reqID", Val: strconv.Itoa(rand.Intn(100000))})
+	reqID := middleware.RequestIDFromContext(req.Context())
+	if reqID == "" {
+		reqID = strconv.Itoa(rand.Intn(100000))
+	}
+	logger := logs.NewLogger(logs.FieldValue{Key: "reqID", Val: reqID})
 	logger.Infof("Request received %s", req.URL.Path)
-	cacheKey := req.URL.Path
-	if found, ok := cache.Load(cacheKey); ok {
-		resWrapper := found.(httpResponseWriterWrapper)
-		res.WriteHeader(resWrapper.resStatusCode)
-		for k, vs := range resWrapper.headers {
-			for _, v := range vs {
-				res.Header().Add(k, v)
+	route, ok := routes.Match(req.Host, req.URL.Path)
+	if !ok {
+		logger.Infof("No route for host %s", req.Host)
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	*req = *req.WithContext(middleware.WithRoute(req.Context(), route.Host+route.Location))
+	if isUpgradeRequest(req) {
+		serveUpgrade(res, req, route, logger)
+		return
+	}
+	cacheable := req.Method == http.MethodGet
+	var entry *proxycache.Entry
+	var cacheKey string
+	if cacheable {
+		// Computed before req.Host/req.URL are rewritten below, so a
+		// rewriteHost route's Store/Refresh key matches what Lookup used.
+		cacheKey = respCache.Key(req)
+		if found, ok := respCache.Lookup(cacheKey, req); ok {
+			entry = found
+			if !entry.Stale() {
+				middleware.IncCacheHit()
+				writeFromCache(res, entry)
+				logger.Info("Return response from cache")
+				return
 			}
 		}
-		fmt.Fprint(res, resWrapper.remoteResponse.String())
-		logger.Info("Return response from cache")
+	}
+	backend, ok := pools[route].Next()
+	if !ok {
+		logger.Error(fmt.Errorf("no healthy upstream for %s%s", route.Host, route.Location))
+		res.WriteHeader(http.StatusBadGateway)
 		return
 	}
-	url, err := url.Parse(fmt.Sprintf("%s://%s", httpProtocol, targetHost))
-	if err != nil {
-		setInternalErrorResponse(logger, res, err)
-	} else if err = readRequest(logger, req); err != nil {
+	if err := readRequest(logger, req); err != nil {
 		setInternalErrorResponse(logger, res, err)
-	} else {
-		proxy := httputil.NewSingleHostReverseProxy(url)
-		req.URL.Host = url.Host
-		req.URL.Scheme = url.Scheme
-		req.Header.Set("X-Forwarded-Host", req.Header.Get("Host"))
-		req.Host = url.Host
-		logger.Info("Making proxy")
-		resWrapper := httpResponseWriterWrapper{res, strings.Builder{}, res.Header(), 0}
-		proxy.ServeHTTP(&resWrapper, req)
-		if printTargetResponse {
-			logger.Info(resWrapper.String())
+		return
+	}
+	if entry != nil && entry.Revalidatable() {
+		proxycache.ApplyValidators(req, entry)
+	}
+	req.URL.Host = backend.URL.Host
+	req.URL.Scheme = backend.URL.Scheme
+	req.Header.Set("X-Forwarded-Host", req.Header.Get("Host"))
+	if route.RewriteHost {
+		req.Host = backend.URL.Host
+	}
+	upstreamAuths[route].Apply(req)
+	logger.Info("Making proxy")
+	proxy := httputil.NewSingleHostReverseProxy(backend.URL)
+	proxy.FlushInterval = -1
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.Error(err)
+		backend.RecordFailure(pools[route].MaxFailures)
+		middleware.IncUpstreamError()
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	backend.Acquire()
+	defer backend.Release()
+	// Revalidation must not reach the client before we know whether the
+	// upstream answered 304 (serve the cached body) or 200 (serve this).
+	target := res
+	revalidating := entry != nil
+	var recorder *httptest.ResponseRecorder
+	if revalidating {
+		recorder = httptest.NewRecorder()
+		target = recorder
+	}
+	resWrapper := httpResponseWriterWrapper{
+		ResponseWriter: target,
+		headers:        target.Header(),
+		bufferable:     cacheable,
+		maxBufferBytes: cacheMaxBodyBytes,
+	}
+	proxy.ServeHTTP(&resWrapper, req)
+	if resWrapper.resStatusCode >= 500 {
+		backend.RecordFailure(pools[route].MaxFailures)
+		middleware.IncUpstreamError()
+	} else if resWrapper.resStatusCode > 0 {
+		backend.RecordSuccess()
+	}
+	if printTargetResponse {
+		logger.Info(resWrapper.String())
+	}
+	if revalidating && resWrapper.resStatusCode == http.StatusNotModified {
+		ttl, ok := proxycache.TTLFromHeader(resWrapper.headers)
+		if !ok {
+			ttl = time.Duration(cacheTimeout) * time.Minute
+		}
+		respCache.Refresh(cacheKey, req, entry, ttl)
+		writeFromCache(res, entry)
+		return
+	}
+	if revalidating {
+		writeFromWrapper(res, &resWrapper, recorder)
+	}
+	if cacheable && !resWrapper.overCap && resWrapper.resStatusCode >= 200 && resWrapper.resStatusCode < 300 {
+		respCache.Store(cacheKey, req, resWrapper.resStatusCode, resWrapper.headers, []byte(resWrapper.remoteResponse.String()))
+	}
+}
+
+// isUpgradeRequest reports whether req is asking to switch protocols (e.g.
+// a WebSocket handshake), which must be proxied as a raw hijacked
+// connection rather than through the buffering response wrapper.
+func isUpgradeRequest(req *http.Request) bool {
+	if req.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, token := range strings.Split(req.Header.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(token), "Upgrade") {
+			return true
 		}
-		if req.Method == http.MethodGet && resWrapper.resStatusCode >= 200 && resWrapper.resStatusCode < 300 {
-			cache.Store(cacheKey, resWrapper)
-			time.AfterFunc(time.Duration(cacheTimeout)*time.Minute, func() {
-				cache.Delete(cacheKey)
-			})
+	}
+	return false
+}
+
+// serveUpgrade proxies a protocol-upgrade request (WebSocket) straight
+// through to the backend: httputil.ReverseProxy hijacks the connection
+// itself, so no wrapper or caching can sit in between.
+func serveUpgrade(res http.ResponseWriter, req *http.Request, route *router.Route, logger *logs.Logger) {
+	backend, ok := pools[route].Next()
+	if !ok {
+		logger.Error(fmt.Errorf("no healthy upstream for %s%s", route.Host, route.Location))
+		res.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	req.URL.Host = backend.URL.Host
+	req.URL.Scheme = backend.URL.Scheme
+	req.Header.Set("X-Forwarded-Host", req.Header.Get("Host"))
+	if route.RewriteHost {
+		req.Host = backend.URL.Host
+	}
+	upstreamAuths[route].Apply(req)
+	logger.Info("Making upgrade proxy")
+	proxy := httputil.NewSingleHostReverseProxy(backend.URL)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.Error(err)
+		backend.RecordFailure(pools[route].MaxFailures)
+		middleware.IncUpstreamError()
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	backend.Acquire()
+	defer backend.Release()
+	proxy.ServeHTTP(res, req)
+}
+
+func writeFromCache(res http.ResponseWriter, entry *proxycache.Entry) {
+	for k, vs := range entry.Header {
+		for _, v := range vs {
+			res.Header().Add(k, v)
 		}
 	}
+	res.WriteHeader(entry.StatusCode)
+	res.Write(entry.Body)
+}
+
+// writeFromWrapper copies a response buffered for revalidation (it was
+// written to a recorder, not res) on to the real client. The body comes
+// from the recorder itself, not resWrapper.remoteResponse: Write stops
+// buffering and discards what it had once the body exceeds
+// maxBufferBytes, which would otherwise truncate the response actually
+// sent to the client. httptest.ResponseRecorder always keeps the full
+// body regardless of that cap.
+func writeFromWrapper(res http.ResponseWriter, w *httpResponseWriterWrapper, recorder *httptest.ResponseRecorder) {
+	for k, vs := range w.headers {
+		for _, v := range vs {
+			res.Header().Add(k, v)
+		}
+	}
+	res.WriteHeader(w.resStatusCode)
+	res.Write(recorder.Body.Bytes())
 }
 
 type errUnknownHTTPResponse struct {
@@ -146,23 +398,52 @@ func setInternalErrorResponse(logger *logs.Logger, res http.ResponseWriter, err
 	fmt.Fprintln(res, "Erro interno")
 }
 
+// httpResponseWriterWrapper buffers a copy of the response body alongside
+// passing it through to the real ResponseWriter, so the body can be cached
+// and/or logged. Buffering is opt-in: it only happens when bufferable is
+// set (a cacheable GET) and the response isn't chunked, and stops, spilling
+// what was already buffered, once maxBufferBytes is exceeded so a large or
+// streamed response isn't held in memory in full.
 type httpResponseWriterWrapper struct {
 	http.ResponseWriter
 	remoteResponse strings.Builder
-	headers http.Header
-	resStatusCode int
+	headers        http.Header
+	resStatusCode  int
+
+	bufferable     bool
+	buffering      bool
+	maxBufferBytes int
+	overCap        bool
 }
 
 func (r *httpResponseWriterWrapper) Write(b []byte) (int, error) {
-	r.remoteResponse.Write(b)
+	if r.buffering {
+		if r.remoteResponse.Len()+len(b) > r.maxBufferBytes {
+			r.overCap = true
+			r.buffering = false
+			r.remoteResponse.Reset()
+		} else {
+			r.remoteResponse.Write(b)
+		}
+	}
 	return r.ResponseWriter.Write(b)
 }
 
 func (r *httpResponseWriterWrapper) WriteHeader(statusCode int) {
 	r.resStatusCode = statusCode
+	r.buffering = r.bufferable && !strings.EqualFold(r.headers.Get("Transfer-Encoding"), "chunked")
 	r.ResponseWriter.WriteHeader(statusCode)
 }
 
 func (r *httpResponseWriterWrapper) String() string {
 	return fmt.Sprintf("{Target-response: Status %d - Header %v - Body %s}", r.resStatusCode, r.headers, r.remoteResponse.String())
 }
+
+// Unwrap lets http.NewResponseController see through the wrapper to the
+// real ResponseWriter, so it can still find Flush (and any other optional
+// interface) on it. Without this, embedding http.ResponseWriter as an
+// interface field doesn't promote those methods, and the proxy.FlushInterval
+// set in serveReverseProxy has no effect on streamed responses.
+func (r *httpResponseWriterWrapper) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
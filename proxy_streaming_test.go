@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Murilovisque/go-proxy/balancer"
+	proxycache "github.com/Murilovisque/go-proxy/cache"
+	"github.com/Murilovisque/go-proxy/router"
+	"github.com/Murilovisque/go-proxy/upstreamauth"
+)
+
+// TestServeReverseProxyStreamsIncrementally proxies a two-event SSE stream
+// end-to-end through serveReverseProxy and checks the first event reaches
+// the client immediately instead of waiting for the whole response, i.e.
+// that httpResponseWriterWrapper actually lets FlushInterval=-1 flush.
+func TestServeReverseProxyStreamsIncrementally(t *testing.T) {
+	eventGap := time.Second
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		flusher.Flush()
+		time.Sleep(eventGap)
+		fmt.Fprint(w, "data: second\n\n")
+		flusher.Flush()
+	}))
+	defer backend.Close()
+
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := balancer.NewPool([]string{backendURL.String()}, balancer.RoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origRoutes, origPools, origAuths, origCache := routes, pools, upstreamAuths, respCache
+	defer func() { routes, pools, upstreamAuths, respCache = origRoutes, origPools, origAuths, origCache }()
+
+	cfg := &router.Config{Routes: []router.Route{{Host: "example.com", Location: "/"}}}
+	routes = router.New(cfg)
+	route := &cfg.Routes[0]
+	pools = map[*router.Route]*balancer.Pool{route: pool}
+	upstreamAuths = map[*router.Route]*upstreamauth.Injector{route: nil}
+	respCache, err = proxycache.New(10, cacheMaxBodyBytes, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(http.HandlerFunc(serveReverseProxy))
+	defer proxy.Close()
+
+	req, err := http.NewRequest(http.MethodGet, proxy.URL+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "example.com"
+	start := time.Now()
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	reader := bufio.NewReader(res.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstByteLatency := time.Since(start)
+	if line != "data: first\n" {
+		t.Fatalf("unexpected first line %q", line)
+	}
+	if firstByteLatency >= eventGap/2 {
+		t.Fatalf("first event took %s to arrive, wanted well under the %s gap between events; streaming is not flushing incrementally", firstByteLatency, eventGap)
+	}
+}
@@ -0,0 +1,134 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Route describes a single virtual-host / path mapping to one or more
+// upstream targets.
+type Route struct {
+	// Host is matched against the incoming request's Host header. It can be
+	// an exact host (e.g. "api.example.com") or a wildcard (e.g.
+	// "*.example.com"), which matches subdomains at any depth but not the
+	// bare "example.com".
+	Host string `json:"host" yaml:"host"`
+	// Location is the path prefix this route answers for. Longer prefixes
+	// take precedence over shorter ones for the same host.
+	Location string `json:"location" yaml:"location"`
+	// RewriteHost, when true, sets the outgoing request's Host header to the
+	// upstream's host instead of forwarding the original Host.
+	RewriteHost bool `json:"rewriteHost" yaml:"rewriteHost"`
+	// Upstreams lists one or more backend URLs able to serve this route.
+	Upstreams []string `json:"upstreams" yaml:"upstreams"`
+
+	// Strategy picks how Upstreams are balanced: "round-robin" (default),
+	// "random" or "least-conn".
+	Strategy string `json:"strategy" yaml:"strategy"`
+	// HealthCheckPath, when set, is polled with a GET every
+	// HealthCheckIntervalSeconds to actively detect a dead upstream.
+	HealthCheckPath string `json:"healthCheckPath" yaml:"healthCheckPath"`
+	// HealthCheckIntervalSeconds is the active health check period. Ignored
+	// when HealthCheckPath is empty; defaults to 10 seconds when
+	// HealthCheckPath is set but this is zero.
+	HealthCheckIntervalSeconds int `json:"healthCheckIntervalSeconds" yaml:"healthCheckIntervalSeconds"`
+	// MaxFailures is the number of consecutive 5xx/dial errors that ejects
+	// an upstream via passive circuit breaking. Defaults to 3 when zero.
+	MaxFailures int `json:"maxFailures" yaml:"maxFailures"`
+
+	// UpstreamAuth, when set, injects credentials into the request before
+	// it reaches this route's upstreams.
+	UpstreamAuth *UpstreamAuthConfig `json:"upstreamAuth" yaml:"upstreamAuth"`
+}
+
+// UpstreamAuthConfig describes how to authenticate outgoing requests to a
+// route's upstreams. Headers, BearerTokenFile and BasicAuth can be combined;
+// they're applied in that order, so BasicAuth wins if more than one sets
+// the Authorization header.
+type UpstreamAuthConfig struct {
+	// StripInboundAuth removes any Authorization header the caller sent
+	// before the credentials below are applied.
+	StripInboundAuth bool `json:"stripInboundAuth" yaml:"stripInboundAuth"`
+	// Headers are static name/value pairs merged into the outgoing request.
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// BearerTokenFile, when set, is read for a bearer token and re-read
+	// whenever the file changes on disk.
+	BearerTokenFile string `json:"bearerTokenFile" yaml:"bearerTokenFile"`
+	// BasicAuth, when set, builds an HTTP basic auth Authorization header.
+	BasicAuth *BasicAuthConfig `json:"basicAuth" yaml:"basicAuth"`
+}
+
+// BasicAuthConfig holds the credentials for HTTP basic auth.
+type BasicAuthConfig struct {
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+}
+
+// Config is the top level routing configuration loaded from -config.
+type Config struct {
+	Routes     []Route          `json:"routes" yaml:"routes"`
+	Middleware MiddlewareConfig `json:"middleware" yaml:"middleware"`
+}
+
+// MiddlewareConfig turns the built-in middlewares on and off. Every entry
+// defaults to disabled so existing configs keep behaving the same way.
+type MiddlewareConfig struct {
+	Recover    bool             `json:"recover" yaml:"recover"`
+	RequestID  bool             `json:"requestID" yaml:"requestID"`
+	RateLimit  *RateLimitConfig `json:"rateLimit" yaml:"rateLimit"`
+	Prometheus bool             `json:"prometheus" yaml:"prometheus"`
+}
+
+// RateLimitConfig configures the token-bucket rate limit middleware.
+type RateLimitConfig struct {
+	RPS   float64 `json:"rps" yaml:"rps"`
+	Burst int     `json:"burst" yaml:"burst"`
+}
+
+// LoadConfig reads a routing Config from a YAML or JSON file, chosen by the
+// file extension (.yaml, .yml or .json).
+func LoadConfig(path string) (*Config, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(raw, cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, cfg)
+	default:
+		return nil, fmt.Errorf("unsupported config extension %q, expected .json, .yaml or .yml", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	if len(c.Routes) == 0 {
+		return fmt.Errorf("config has no routes")
+	}
+	for i, r := range c.Routes {
+		if r.Host == "" {
+			return fmt.Errorf("route %d: host is required", i)
+		}
+		if r.Location == "" {
+			return fmt.Errorf("route %d: location is required", i)
+		}
+		if len(r.Upstreams) == 0 {
+			return fmt.Errorf("route %d: at least one upstream is required", i)
+		}
+	}
+	return nil
+}
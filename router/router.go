@@ -0,0 +1,95 @@
+// Package router implements the vhost/location muxer used to pick, for a
+// given incoming request, which Route (and therefore which upstreams)
+// should serve it.
+package router
+
+import (
+	"sort"
+	"strings"
+)
+
+// Router resolves an incoming (host, path) pair to the Route that should
+// serve it. Routes are indexed by host and, within a host, by location
+// ordered from longest to shortest so the most specific prefix wins.
+type Router struct {
+	exactHosts       map[string][]*Route
+	wildcardHosts    map[string][]*Route // keyed by the suffix after "*."
+	wildcardSuffixes []string            // keys of wildcardHosts, longest suffix first
+}
+
+// New builds a Router from a Config. Routes sharing the same host are
+// grouped together and sorted by Location length, longest first.
+func New(cfg *Config) *Router {
+	r := &Router{
+		exactHosts:    make(map[string][]*Route),
+		wildcardHosts: make(map[string][]*Route),
+	}
+	for i := range cfg.Routes {
+		route := &cfg.Routes[i]
+		if strings.HasPrefix(route.Host, "*.") {
+			suffix := route.Host[1:] // keep the leading dot, e.g. ".example.com"
+			r.wildcardHosts[suffix] = append(r.wildcardHosts[suffix], route)
+		} else {
+			r.exactHosts[route.Host] = append(r.exactHosts[route.Host], route)
+		}
+	}
+	for _, routes := range r.exactHosts {
+		sortByLocationLenDesc(routes)
+	}
+	for suffix, routes := range r.wildcardHosts {
+		sortByLocationLenDesc(routes)
+		r.wildcardSuffixes = append(r.wildcardSuffixes, suffix)
+	}
+	// Longest suffix first, so "*.api.example.com" outranks "*.example.com"
+	// for a host both match.
+	sort.Slice(r.wildcardSuffixes, func(i, j int) bool {
+		return len(r.wildcardSuffixes[i]) > len(r.wildcardSuffixes[j])
+	})
+	return r
+}
+
+func sortByLocationLenDesc(routes []*Route) {
+	sort.Slice(routes, func(i, j int) bool {
+		return len(routes[i].Location) > len(routes[j].Location)
+	})
+}
+
+// Match returns the most specific Route serving path under host, and false
+// if no route matches (the caller should respond with 404).
+func (r *Router) Match(host, path string) (*Route, bool) {
+	host = stripPort(host)
+	if routes, ok := r.exactHosts[host]; ok {
+		if route, ok := matchLocation(routes, path); ok {
+			return route, true
+		}
+	}
+	for _, suffix := range r.wildcardSuffixes {
+		if strings.HasSuffix(host, suffix) && host != suffix[1:] {
+			if route, ok := matchLocation(r.wildcardHosts[suffix], path); ok {
+				return route, true
+			}
+		}
+	}
+	if routes, ok := r.exactHosts["*"]; ok {
+		if route, ok := matchLocation(routes, path); ok {
+			return route, true
+		}
+	}
+	return nil, false
+}
+
+func matchLocation(routes []*Route, path string) (*Route, bool) {
+	for _, route := range routes {
+		if strings.HasPrefix(path, route.Location) {
+			return route, true
+		}
+	}
+	return nil, false
+}
+
+func stripPort(host string) string {
+	if i := strings.LastIndex(host, ":"); i != -1 {
+		return host[:i]
+	}
+	return host
+}
@@ -0,0 +1,50 @@
+package router
+
+import "testing"
+
+func newTestRouter(routes ...Route) *Router {
+	return New(&Config{Routes: routes})
+}
+
+func TestMatchExactHostLongestLocationWins(t *testing.T) {
+	r := newTestRouter(
+		Route{Host: "example.com", Location: "/", Upstreams: []string{"http://a"}},
+		Route{Host: "example.com", Location: "/api", Upstreams: []string{"http://b"}},
+	)
+	route, ok := r.Match("example.com", "/api/users")
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if route.Location != "/api" {
+		t.Fatalf("got location %q, want /api", route.Location)
+	}
+}
+
+func TestMatchMostSpecificWildcardSuffixWins(t *testing.T) {
+	r := newTestRouter(
+		Route{Host: "*.example.com", Location: "/", Upstreams: []string{"http://a"}},
+		Route{Host: "*.api.example.com", Location: "/", Upstreams: []string{"http://b"}},
+	)
+	route, ok := r.Match("foo.api.example.com", "/")
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if route.Host != "*.api.example.com" {
+		t.Fatalf("got host %q, want the more specific *.api.example.com", route.Host)
+	}
+}
+
+func TestMatchStripsPortBeforeLookup(t *testing.T) {
+	r := newTestRouter(Route{Host: "example.com", Location: "/", Upstreams: []string{"http://a"}})
+	route, ok := r.Match("example.com:8080", "/")
+	if !ok || route.Host != "example.com" {
+		t.Fatal("expected the port to be stripped before matching the host")
+	}
+}
+
+func TestMatchNoRouteReturnsFalse(t *testing.T) {
+	r := newTestRouter(Route{Host: "example.com", Location: "/", Upstreams: []string{"http://a"}})
+	if _, ok := r.Match("other.com", "/"); ok {
+		t.Fatal("expected no match for an unconfigured host")
+	}
+}
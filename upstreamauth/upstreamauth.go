@@ -0,0 +1,104 @@
+// Package upstreamauth injects service credentials into a request before
+// it is proxied, so a route can front a service that requires
+// authentication without the caller ever seeing those credentials.
+package upstreamauth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Murilovisque/go-proxy/router"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Injector applies a route's upstreamAuth config to outgoing requests. A
+// nil *Injector is valid and a no-op, so routes without upstreamAuth don't
+// need special-casing at call sites.
+type Injector struct {
+	stripInbound bool
+	headers      map[string]string
+	basicAuth    *router.BasicAuthConfig
+
+	token atomic.Value // string, populated when BearerTokenFile is set
+}
+
+// New builds an Injector from cfg, starting a file watcher for
+// cfg.BearerTokenFile when set. A nil cfg yields a nil, no-op Injector.
+func New(cfg *router.UpstreamAuthConfig) (*Injector, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	inj := &Injector{
+		stripInbound: cfg.StripInboundAuth,
+		headers:      cfg.Headers,
+		basicAuth:    cfg.BasicAuth,
+	}
+	if cfg.BearerTokenFile != "" {
+		if err := inj.loadToken(cfg.BearerTokenFile); err != nil {
+			return nil, err
+		}
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		// Watch the containing directory rather than the file itself: secret
+		// rotation tools (Kubernetes Secret/ConfigMap mounts, Vault-agent,
+		// atomic config replace) typically swap the file via rename/symlink,
+		// which delivers Remove/Rename and permanently invalidates an
+		// inotify watch held on the file's own path.
+		if err := watcher.Add(filepath.Dir(cfg.BearerTokenFile)); err != nil {
+			return nil, err
+		}
+		go inj.watchToken(watcher, cfg.BearerTokenFile)
+	}
+	return inj, nil
+}
+
+func (i *Injector) loadToken(path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	i.token.Store(strings.TrimSpace(string(raw)))
+	return nil
+}
+
+func (i *Injector) watchToken(watcher *fsnotify.Watcher, path string) {
+	defer watcher.Close()
+	for event := range watcher.Events {
+		if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+			continue
+		}
+		// Kubernetes' Secret/ConfigMap mounts rotate by rename-swapping a
+		// "..data" indirection symlink rather than touching path itself, so
+		// filtering events down to event.Name == path would miss every
+		// rotation. Re-reading path on any qualifying event in the
+		// directory is cheap and idempotent; a transient "file vanished
+		// mid-swap" error from loadToken is ignored, since the next event
+		// in the same swap will succeed.
+		i.loadToken(path)
+	}
+}
+
+// Apply injects this route's configured credentials into req. Safe to call
+// with a nil Injector.
+func (i *Injector) Apply(req *http.Request) {
+	if i == nil {
+		return
+	}
+	if i.stripInbound {
+		req.Header.Del("Authorization")
+	}
+	for name, value := range i.headers {
+		req.Header.Set(name, value)
+	}
+	if tok, ok := i.token.Load().(string); ok && tok != "" {
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
+	if i.basicAuth != nil {
+		req.SetBasicAuth(i.basicAuth.Username, i.basicAuth.Password)
+	}
+}